@@ -0,0 +1,246 @@
+package main
+
+import (
+	"container/heap"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a dedup-index entry: sha maps to the first archived path
+// that holds that content, so a later download with the same bytes can be
+// hardlinked instead of written again.
+type cacheEntry struct {
+	sha   string
+	path  string
+	size  int64
+	atime time.Time
+	index int // heap.Interface bookkeeping
+}
+
+// lruHeap is a min-heap of cacheEntry ordered by atime, so the
+// least-recently-used entry is always at the root.
+type lruHeap []*cacheEntry
+
+func (h lruHeap) Len() int           { return len(h) }
+func (h lruHeap) Less(i, j int) bool { return h[i].atime.Before(h[j].atime) }
+func (h lruHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i]; h[i].index = i; h[j].index = j }
+func (h *lruHeap) Push(x interface{}) {
+	e := x.(*cacheEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *lruHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// diskCache is a content-addressed dedup index over the files a
+// LocalStorage has already archived. It holds no blobs of its own: the
+// archive tree (dir/YYYY/MM/DD/<id>-<name>) is the only copy of any file's
+// bytes, so "eviction" here only forgets an older entry's eligibility for
+// future dedup matches — it never deletes anything from the archive.
+// maxBytes therefore bounds how much of the archive the index tracks for
+// dedup purposes, not how much disk the archive itself uses, which grows
+// exactly as it always has.
+//
+// NOTE: chunk0-6 was filed to bound disk use on long-running cron
+// deployments via --cache-max-bytes. It can't do that literally once
+// dedup is implemented with hardlinks into a permanent archive — deleting
+// an evicted entry's file would delete the one copy of that file's bytes
+// still referenced by the archive path a prior run wrote. This index-only
+// design is the closest honest fit, but it's a narrower guarantee than
+// the original request asked for and should be confirmed with whoever
+// filed it, not just redefined here.
+type diskCache struct {
+	mu         sync.Mutex
+	maxBytes   int64
+	totalBytes int64
+	entries    map[string]*cacheEntry
+	lru        lruHeap
+}
+
+// newDiskCache rebuilds the dedup index by walking dir, the archive root,
+// since the index itself isn't persisted between runs. Files are indexed
+// most-recently-modified first, stopping once maxBytes is reached, so a
+// restart keeps the same entries an LRU policy would already have kept
+// warm.
+func newDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	c := &diskCache{
+		maxBytes: maxBytes,
+		entries:  map[string]*cacheEntry{},
+	}
+
+	type candidate struct {
+		path  string
+		size  int64
+		mtime time.Time
+	}
+	var candidates []candidate
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		candidates = append(candidates, candidate{path: path, size: info.Size(), mtime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].mtime.After(candidates[j].mtime) })
+
+	for _, cand := range candidates {
+		if maxBytes > 0 && c.totalBytes+cand.size > maxBytes {
+			break
+		}
+
+		sha, err := sha256File(cand.path)
+		if err != nil {
+			continue
+		}
+
+		e := &cacheEntry{sha: sha, path: cand.path, size: cand.size, atime: cand.mtime}
+		c.entries[sha] = e
+		heap.Push(&c.lru, e)
+		c.totalBytes += cand.size
+	}
+
+	return c, nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Put archives r at linkPath, deduplicating against an already-archived
+// file with identical content when one is indexed. It returns true if this
+// was a dedup hit (linkPath was hardlinked/symlinked to the existing file
+// rather than written fresh).
+func (c *diskCache) Put(r io.Reader, linkPath string) (dedup bool, err error) {
+	tmpDir := filepath.Dir(linkPath)
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "incoming-*")
+	if err != nil {
+		return false, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(r, h))
+	closeErr := tmp.Close()
+	if err != nil {
+		return false, err
+	}
+	if closeErr != nil {
+		return false, closeErr
+	}
+
+	sha := hex.EncodeToString(h.Sum(nil))
+
+	if existing, ok := c.lookup(sha); ok {
+		os.Remove(linkPath)
+		if err := os.Link(existing, linkPath); err != nil {
+			if err := os.Symlink(existing, linkPath); err != nil {
+				return false, err
+			}
+		}
+		c.touch(sha)
+		return true, nil
+	}
+
+	if err := os.Rename(tmpPath, linkPath); err != nil {
+		return false, err
+	}
+
+	c.add(sha, linkPath, size)
+	return false, nil
+}
+
+// lookup returns the archived path for sha if it's indexed and still
+// exists on disk.
+func (c *diskCache) lookup(sha string) (string, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[sha]
+	c.mu.Unlock()
+
+	if !ok {
+		return "", false
+	}
+	if _, err := os.Stat(e.path); err != nil {
+		return "", false
+	}
+	return e.path, true
+}
+
+// touch marks sha as recently used, moving it to the back of the LRU
+// order.
+func (c *diskCache) touch(sha string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[sha]; ok {
+		e.atime = time.Now()
+		heap.Fix(&c.lru, e.index)
+	}
+}
+
+// add indexes a newly-archived file and evicts the least-recently-used
+// index entries until the indexed total fits maxBytes. Eviction only drops
+// the dedup-index entry, never the archived file it points at.
+func (c *diskCache) add(sha, path string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := &cacheEntry{sha: sha, path: path, size: size, atime: time.Now()}
+	c.entries[sha] = e
+	heap.Push(&c.lru, e)
+	c.totalBytes += size
+
+	c.evictLocked()
+}
+
+// evictLocked forgets least-recently-used dedup entries until the index is
+// back within its byte budget. Callers must hold c.mu.
+func (c *diskCache) evictLocked() {
+	if c.maxBytes <= 0 {
+		return
+	}
+
+	for c.totalBytes > c.maxBytes && c.lru.Len() > 0 {
+		e := heap.Pop(&c.lru).(*cacheEntry)
+		delete(c.entries, e.sha)
+		c.totalBytes -= e.size
+	}
+}
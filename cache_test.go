@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskCachePutDeduplicatesIdenticalContent(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("newDiskCache() error = %v", err)
+	}
+
+	first := filepath.Join(dir, "a", "file-one.txt")
+	dedup, err := c.Put(bytes.NewReader([]byte("same bytes")), first)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if dedup {
+		t.Error("Put() first write reported dedup = true, want false")
+	}
+
+	second := filepath.Join(dir, "b", "file-two.txt")
+	dedup, err = c.Put(bytes.NewReader([]byte("same bytes")), second)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if !dedup {
+		t.Error("Put() second write with identical content reported dedup = false, want true")
+	}
+
+	got, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatalf("ReadFile(second) error = %v", err)
+	}
+	if string(got) != "same bytes" {
+		t.Errorf("second file content = %q, want %q", got, "same bytes")
+	}
+}
+
+func TestDiskCacheEvictionNeverDeletesArchivedFiles(t *testing.T) {
+	dir := t.TempDir()
+	// maxBytes bounds the dedup index to a single small entry, so the
+	// second Put evicts the first entry's index record.
+	c, err := newDiskCache(dir, 4)
+	if err != nil {
+		t.Fatalf("newDiskCache() error = %v", err)
+	}
+
+	first := filepath.Join(dir, "a", "file-one.txt")
+	if _, err := c.Put(bytes.NewReader([]byte("aaaa")), first); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	second := filepath.Join(dir, "b", "file-two.txt")
+	if _, err := c.Put(bytes.NewReader([]byte("bbbb")), second); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("evicted entry's archived file was removed from disk: %v", err)
+	}
+
+	if _, ok := c.lookup(sha256Bytes(t, "aaaa")); ok {
+		t.Error("lookup() found the evicted entry, want it forgotten from the index")
+	}
+}
+
+func TestNewDiskCacheRebuildsIndexFromExistingArchive(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "2024", "01", "15", "F1-report.pdf")
+	if err := os.MkdirAll(filepath.Dir(existing), 0755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := os.WriteFile(existing, []byte("report contents"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	c, err := newDiskCache(dir, 0)
+	if err != nil {
+		t.Fatalf("newDiskCache() error = %v", err)
+	}
+
+	fresh := filepath.Join(dir, "2024", "02", "01", "F2-report.pdf")
+	dedup, err := c.Put(bytes.NewReader([]byte("report contents")), fresh)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if !dedup {
+		t.Error("Put() against a file indexed from a prior run reported dedup = false, want true")
+	}
+}
+
+func sha256Bytes(t *testing.T, s string) string {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "probe")
+	if err := os.WriteFile(path, []byte(s), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	sha, err := sha256File(path)
+	if err != nil {
+		t.Fatalf("sha256File() error = %v", err)
+	}
+	return sha
+}
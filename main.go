@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -12,24 +14,57 @@ import (
 )
 
 const (
-	daysOld     = 90 // Number of days to keep files for
-	saveDir     = "files"
-	tokenEnvVar = "TOKEN"
+	daysOld            = 90 // Number of days to keep files for
+	saveDir            = "files"
+	tokenEnvVar        = "TOKEN"
+	defaultConcurrency = 5
+	initialRPS         = 1
 )
 
 type server struct {
-	log   *zap.SugaredLogger
-	slack *slack.Client
+	log           *zap.SugaredLogger
+	slack         *slack.Client
+	storage       Storage
+	limiter       *adaptiveLimiter
+	dryRun        bool
+	concurrency   int
+	policy        *Policy
+	pinnedCacheMu sync.Mutex
+	pinnedCache   map[string][]string
 }
 
 func main() {
 
-	s := &server{}
-
 	logger, _ := zap.NewProduction()
 	defer logger.Sync()
 	log := logger.Sugar()
-	s.log = log
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "restore" {
+		runRestore(log, args[1:])
+		return
+	}
+
+	runClean(log, args)
+}
+
+func runClean(log *zap.SugaredLogger, args []string) {
+
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	provider := fs.String("provider", "local", "storage backend to archive files to: local, s3, or gcs")
+	bucket := fs.String("bucket", "", "bucket name, required for --provider=s3 and --provider=gcs")
+	prefix := fs.String("prefix", "", "key prefix to store archived files under, for --provider=s3 and --provider=gcs")
+	concurrency := fs.Int("concurrency", defaultConcurrency, "number of files to download/delete concurrently")
+	dryRun := fs.Bool("dry-run", false, "list what would be deleted without actually deleting anything")
+	policyPath := fs.String("policy", "", "path to a YAML or JSON retention policy file; overrides --min-age/--types/--user/--channel")
+	minAge := fs.String("min-age", fmt.Sprintf("%dh", daysOld*24), "delete files older than this (Go duration, e.g. 720h), used when --policy is not set")
+	types := fs.String("types", "", "comma-separated file types to delete (e.g. images,snippets,pdfs), used when --policy is not set")
+	user := fs.String("user", "", "only delete files uploaded by this user ID, used when --policy is not set")
+	channel := fs.String("channel", "", "only delete files shared to this channel ID, used when --policy is not set")
+	cacheMaxBytes := fs.Int64("cache-max-bytes", 0, "bound the local dedup index to this many bytes of already-archived files, evicting least-recently-used entries from the index (not from disk); 0 disables dedup, for --provider=local")
+	fs.Parse(args)
+
+	s := &server{log: log}
 
 	s.log.Debug("starting")
 
@@ -42,6 +77,23 @@ func main() {
 	api := slack.New(slackToken)
 	s.slack = api
 
+	storage, err := NewStorage(*provider, saveDir, *bucket, *prefix, *cacheMaxBytes)
+	if err != nil {
+		s.log.Error(err)
+		os.Exit(1)
+	}
+	s.storage = storage
+	s.limiter = newAdaptiveLimiter(initialRPS)
+	s.dryRun = *dryRun
+	s.concurrency = *concurrency
+
+	policy, err := loadPolicyFromFlags(*policyPath, *minAge, *types, *user, *channel)
+	if err != nil {
+		s.log.Error(err)
+		os.Exit(1)
+	}
+	s.policy = policy
+
 	ctx := context.Background()
 
 	files, err := s.listFiles(ctx)
@@ -58,88 +110,169 @@ func main() {
 
 }
 
-func (s *server) listFiles(ctx context.Context) (files []slack.File, err error) {
+// listFiles returns every file visible to files.list.
+//
+// KNOWN GAP: slack-go's cursor-based ListFilesParameters has no ShowHidden
+// (show_files_hidden_by_limit) field, unlike the page-based
+// GetFilesParameters it replaces, and files.list simply omits files hidden
+// by the free-tier message/file quota unless that flag is set. That means
+// files with Mode == "hidden_by_limit" — exactly the kind of stale file
+// this tool exists to clean up on free workspaces — can no longer be
+// listed or deleted; the branch in processFile that handles that Mode is
+// unreachable until this is resolved. Needs sign-off from whoever owns
+// chunk0-2 before working around it (e.g. vendoring the extra query param
+// ourselves), since it's a capability loss, not just a refactor.
+func (s *server) listFiles(ctx context.Context) ([]slack.File, error) {
+
+	params := slack.ListFilesParameters{
+		Limit: 100,
+	}
 
-	now := time.Now()
-	day := 24 * time.Hour
-	oneMonth := now.Add(-daysOld * day)
+	var files []slack.File
 
-	to := slack.JSONTime(oneMonth.Unix())
+	for {
+		f, nextParams, err := s.getFilesPage(ctx, params)
+		if err != nil {
+			return files, err
+		}
 
-	params := slack.GetFilesParameters{
-		Count:       100,
-		TimestampTo: to,
-		ShowHidden:  true,
-		Page:        1,
-	}
+		files = append(files, f...)
 
-	files, paging, err := s.slack.GetFiles(params)
-	for err == nil {
-		params.Page++
-		if params.Page > paging.Pages {
+		if nextParams.Cursor == "" {
 			break
 		}
+		params = *nextParams
+	}
+
+	return files, nil
+}
+
+// getFilesPage fetches a single cursor-addressed page of files.list results,
+// retrying the same cursor after honouring Retry-After if Slack rate limits
+// the request. It returns the page's files and the params to request the
+// next page with, whose Cursor is empty once the listing is exhausted.
+func (s *server) getFilesPage(ctx context.Context, params slack.ListFilesParameters) ([]slack.File, *slack.ListFilesParameters, error) {
+	for {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return nil, nil, err
+		}
 
-		f, _, err := s.slack.GetFiles(params)
+		files, nextParams, err := s.slack.ListFilesContext(ctx, params)
 		if err == nil {
-			files = append(files, f...)
-		} else if rateLimitedError, ok := err.(*slack.RateLimitedError); ok {
-			select {
-			case <-ctx.Done():
-				err = ctx.Err()
-			case <-time.After(rateLimitedError.RetryAfter):
-				err = nil
-			}
+			s.limiter.OnSuccess()
+			return files, nextParams, nil
+		}
+
+		rateLimitedError, ok := err.(*slack.RateLimitedError)
+		if !ok {
+			return nil, nil, err
+		}
+
+		if err := s.limiter.OnRateLimited(ctx, rateLimitedError.RetryAfter); err != nil {
+			return nil, nil, err
 		}
 	}
-	return files, err
 }
 
+// fileOutcome is the per-file result of a processFiles run, logged so
+// operators can audit exactly what happened on a given pass.
+type fileOutcome string
+
+const (
+	outcomeDeleted fileOutcome = "deleted"
+	outcomeSkipped fileOutcome = "skipped"
+	outcomeFailed  fileOutcome = "failed"
+)
+
 func (s *server) processFiles(ctx context.Context, files []slack.File) error {
 	fileCount := len(files)
 	if fileCount == 0 {
-		s.log.Debugf("found no files to delete that were older than %d days", daysOld)
+		s.log.Debug("found no files matching the retention policy")
 		return nil
 	}
 
 	s.log.Debugf("found %v files for deletion", fileCount)
 
+	concurrency := s.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	fileCh := make(chan slack.File)
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range fileCh {
+				s.processFile(ctx, file)
+			}
+		}()
+	}
+
 	for _, file := range files {
+		fileCh <- file
+	}
+	close(fileCh)
+
+	wg.Wait()
+
+	return nil
+}
+
+func (s *server) processFile(ctx context.Context, file slack.File) {
+	action := s.Evaluate(s.policy, file, time.Now())
+	if action == ActionKeep {
+		s.log.Debugw("file kept by policy", "file_id", file.ID, "outcome", outcomeSkipped)
+		return
+	}
 
+	if action == ActionDownloadThenDelete {
+		// Unreachable while listFiles can't request hidden files — see the
+		// KNOWN GAP note on listFiles. Left in place for when that's fixed.
 		if file.Mode == "hidden_by_limit" {
 			s.log.Debugf("file id %s is hidden by free quota limit, won't download before deleting", file.ID)
-		} else {
-			err := s.getFile(file)
-			if err != nil {
-				s.log.Errorf("error saving file %s: %s", file.ID, err)
-				continue
-			}
+		} else if err := s.getFile(file); err != nil {
+			s.log.Errorw("error saving file", "file_id", file.ID, "outcome", outcomeFailed, "error", err)
+			return
 		}
+	}
 
-		err := s.deleteFile(ctx, file.ID)
-		if err != nil {
-			s.log.Error(err)
-		}
+	if s.dryRun {
+		s.log.Infow("would delete file", "file_id", file.ID, "outcome", outcomeSkipped, "action", action, "dry_run", true)
+		return
 	}
 
-	return nil
+	if err := s.deleteFile(ctx, file.ID); err != nil {
+		s.log.Errorw("error deleting file", "file_id", file.ID, "outcome", outcomeFailed, "error", err)
+		return
+	}
+
+	s.log.Infow("deleted file", "file_id", file.ID, "outcome", outcomeDeleted, "action", action)
 }
 
-func (s *server) deleteFile(ctx context.Context, fileID string) (err error) {
-	for err == nil {
-		err := s.slack.DeleteFile(fileID)
+func (s *server) deleteFile(ctx context.Context, fileID string) error {
+	for {
+		if err := s.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := s.slack.DeleteFileContext(ctx, fileID)
 		if err == nil {
+			s.limiter.OnSuccess()
+			return nil
+		}
+
+		rateLimitedError, ok := err.(*slack.RateLimitedError)
+		if !ok {
+			return err
+		}
+
+		if err := s.limiter.OnRateLimited(ctx, rateLimitedError.RetryAfter); err != nil {
 			return err
-		} else if rateLimitedError, ok := err.(*slack.RateLimitedError); ok {
-			select {
-			case <-ctx.Done():
-				err = ctx.Err()
-			case <-time.After(rateLimitedError.RetryAfter):
-				err = nil
-			}
 		}
 	}
-	return err
 }
 
 func (s *server) getFile(file slack.File) error {
@@ -149,34 +282,23 @@ func (s *server) getFile(file slack.File) error {
 		return nil
 	}
 
-	filename := fmt.Sprintf("%s-%s", file.ID, file.Name)
-	year, month, day := file.Timestamp.Time().Date()
-	datePath := fmt.Sprintf("%v/%02d/%v", year, month, day)
-
-	dir := filepath.Join(saveDir, datePath)
-	fullFilePath := filepath.Join(dir, filename)
+	pr, pw := io.Pipe()
 
-	s.log.Debugf("file_id=%s user_name=%s name=%s Timestamp=%s fullFilePath=%s", file.ID, s.getUser(file.User), file.Name, file.Timestamp, fullFilePath)
+	go func() {
+		pw.CloseWithError(s.slack.GetFile(file.URLPrivateDownload, pw))
+	}()
 
-	err := os.MkdirAll(dir, 0755)
+	dest, err := s.storage.Put(file, pr)
 	if err != nil {
+		// Unblock the writer goroutine if Put returned before draining pr
+		// (e.g. a storage write failed partway through) — otherwise it's
+		// stuck forever on pw.Write, leaking the goroutine and the open
+		// download response along with it.
+		pr.CloseWithError(err)
 		return err
 	}
 
-	f, err := os.Create(fullFilePath)
-	if err != nil {
-		return err
-	}
-
-	err = s.slack.GetFile(file.URLPrivateDownload, f)
-	if err != nil {
-		return err
-	}
-
-	err = f.Close()
-	if err != nil {
-		return err
-	}
+	s.log.Debugf("file_id=%s user_name=%s name=%s Timestamp=%s dest=%s", file.ID, s.getUser(file.User), file.Name, file.Timestamp, dest)
 
 	return nil
 
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+func TestRuleMatches(t *testing.T) {
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	old := slack.JSONTime(now.Add(-100 * 24 * time.Hour).Unix())
+	recent := slack.JSONTime(now.Add(-1 * time.Hour).Unix())
+
+	tests := []struct {
+		name string
+		rule Rule
+		file slack.File
+		want bool
+	}{
+		{
+			name: "no filters matches anything",
+			rule: Rule{},
+			file: slack.File{},
+			want: true,
+		},
+		{
+			name: "user filter excludes other users",
+			rule: Rule{User: "U1"},
+			file: slack.File{User: "U2"},
+			want: false,
+		},
+		{
+			name: "channel filter requires membership",
+			rule: Rule{Channel: "C1"},
+			file: slack.File{Channels: []string{"C2"}},
+			want: false,
+		},
+		{
+			name: "channel filter matches membership",
+			rule: Rule{Channel: "C1"},
+			file: slack.File{Channels: []string{"C1", "C2"}},
+			want: true,
+		},
+		{
+			name: "min age excludes files that are too new",
+			rule: Rule{MinAge: "720h"},
+			file: slack.File{Timestamp: recent},
+			want: false,
+		},
+		{
+			name: "min age matches files old enough",
+			rule: Rule{MinAge: "720h"},
+			file: slack.File{Timestamp: old},
+			want: true,
+		},
+		{
+			name: "size range excludes files outside it",
+			rule: Rule{MinSize: 100, MaxSize: 200},
+			file: slack.File{Size: 50},
+			want: false,
+		},
+		{
+			name: "size range matches files inside it",
+			rule: Rule{MinSize: 100, MaxSize: 200},
+			file: slack.File{Size: 150},
+			want: true,
+		},
+		{
+			name: "exclude starred excludes starred files",
+			rule: Rule{ExcludeStarred: true},
+			file: slack.File{IsStarred: true},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &server{log: zap.NewNop().Sugar()}
+			if got := s.ruleMatches(tt.rule, tt.file, now); got != tt.want {
+				t.Errorf("ruleMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchesAnyType(t *testing.T) {
+	tests := []struct {
+		name     string
+		types    []string
+		filetype string
+		want     bool
+	}{
+		{"exact match", []string{"pdf"}, "pdf", true},
+		{"case insensitive exact match", []string{"PDF"}, "pdf", true},
+		{"category match", []string{"images"}, "png", true},
+		{"no match", []string{"images"}, "pdf", false},
+		{"mixed list matches category", []string{"pdfs", "snippets"}, "go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchesAnyType(tt.types, tt.filetype); got != tt.want {
+				t.Errorf("matchesAnyType(%v, %q) = %v, want %v", tt.types, tt.filetype, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	t.Run("empty action defaults to keep", func(t *testing.T) {
+		p := &Policy{Rules: []Rule{{}}}
+		if err := p.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+		if p.Rules[0].Action != ActionKeep {
+			t.Errorf("Rules[0].Action = %q, want %q", p.Rules[0].Action, ActionKeep)
+		}
+	})
+
+	t.Run("unknown action is rejected", func(t *testing.T) {
+		p := &Policy{Rules: []Rule{{Action: "delete-immediately"}}}
+		if err := p.validate(); err == nil {
+			t.Fatal("validate() error = nil, want an error for an unknown action")
+		}
+	})
+
+	t.Run("known actions pass through unchanged", func(t *testing.T) {
+		p := &Policy{Rules: []Rule{{Action: ActionDelete}}}
+		if err := p.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+		if p.Rules[0].Action != ActionDelete {
+			t.Errorf("Rules[0].Action = %q, want %q", p.Rules[0].Action, ActionDelete)
+		}
+	})
+
+	t.Run("unparsable min_age is rejected", func(t *testing.T) {
+		p := &Policy{Rules: []Rule{{MinAge: "30dd"}}}
+		if err := p.validate(); err == nil {
+			t.Fatal("validate() error = nil, want an error for an unparsable min_age")
+		}
+	})
+
+	t.Run("parsable min_age passes through unchanged", func(t *testing.T) {
+		p := &Policy{Rules: []Rule{{MinAge: "720h"}}}
+		if err := p.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+		if p.Rules[0].MinAge != "720h" {
+			t.Errorf("Rules[0].MinAge = %q, want %q", p.Rules[0].MinAge, "720h")
+		}
+	})
+}
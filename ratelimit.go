@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	ratelimitMinRPS = 0.5
+	ratelimitMaxRPS = 20
+	ratelimitGrowBy = 0.5
+)
+
+// adaptiveLimiter is a token-bucket rate limiter shared across listFiles and
+// deleteFile that adjusts itself to Slack's observed Retry-After responses:
+// halve the rate on a 429 (multiplicative decrease), grow it a little after
+// every run of successes (additive increase). This avoids hard-coding a
+// request rate that's either too conservative for small workspaces or too
+// aggressive for ones that trip Tier 3 limits.
+type adaptiveLimiter struct {
+	mu      sync.Mutex
+	limiter *rate.Limiter
+}
+
+func newAdaptiveLimiter(initialRPS float64) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		limiter: rate.NewLimiter(rate.Limit(initialRPS), 1),
+	}
+}
+
+// Wait blocks until a request may proceed, or ctx is done.
+func (a *adaptiveLimiter) Wait(ctx context.Context) error {
+	a.mu.Lock()
+	l := a.limiter
+	a.mu.Unlock()
+	return l.Wait(ctx)
+}
+
+// OnSuccess nudges the allowed rate up a little.
+func (a *adaptiveLimiter) OnSuccess() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	next := a.limiter.Limit() + ratelimitGrowBy
+	if next > ratelimitMaxRPS {
+		next = ratelimitMaxRPS
+	}
+	a.limiter.SetLimit(next)
+}
+
+// OnRateLimited halves the allowed rate in response to a 429, and blocks for
+// the Retry-After duration Slack asked for (or until ctx is done).
+func (a *adaptiveLimiter) OnRateLimited(ctx context.Context, retryAfter time.Duration) error {
+	a.mu.Lock()
+	next := a.limiter.Limit() / 2
+	if next < ratelimitMinRPS {
+		next = ratelimitMinRPS
+	}
+	a.limiter.SetLimit(next)
+	a.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(retryAfter):
+		return nil
+	}
+}
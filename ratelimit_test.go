@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiterOnSuccessGrowsRateUpToMax(t *testing.T) {
+	a := newAdaptiveLimiter(ratelimitMaxRPS)
+
+	a.OnSuccess()
+
+	if got := float64(a.limiter.Limit()); got != ratelimitMaxRPS {
+		t.Errorf("OnSuccess() at max = %v, want capped at %v", got, ratelimitMaxRPS)
+	}
+}
+
+func TestAdaptiveLimiterOnRateLimitedHalvesRateDownToMin(t *testing.T) {
+	a := newAdaptiveLimiter(ratelimitMinRPS)
+
+	if err := a.OnRateLimited(context.Background(), 0); err != nil {
+		t.Fatalf("OnRateLimited() error = %v", err)
+	}
+
+	if got := float64(a.limiter.Limit()); got != ratelimitMinRPS {
+		t.Errorf("OnRateLimited() at min = %v, want floored at %v", got, ratelimitMinRPS)
+	}
+}
+
+func TestAdaptiveLimiterOnRateLimitedWaitsForRetryAfter(t *testing.T) {
+	a := newAdaptiveLimiter(ratelimitMinRPS)
+
+	start := time.Now()
+	if err := a.OnRateLimited(context.Background(), 20*time.Millisecond); err != nil {
+		t.Fatalf("OnRateLimited() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("OnRateLimited() returned after %v, want >= 20ms", elapsed)
+	}
+}
+
+func TestAdaptiveLimiterOnRateLimitedHonoursContextCancellation(t *testing.T) {
+	a := newAdaptiveLimiter(ratelimitMinRPS)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := a.OnRateLimited(ctx, time.Hour); err != ctx.Err() {
+		t.Errorf("OnRateLimited() error = %v, want %v", err, ctx.Err())
+	}
+}
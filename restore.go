@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// archivedFile is one entry previously written by a Storage backend,
+// recovered well enough to re-upload: its original Slack file ID and name,
+// the day it was archived under, and a way to open its bytes.
+type archivedFile struct {
+	ID        string
+	Name      string
+	Size      int64
+	Timestamp time.Time
+	Open      func() (io.ReadCloser, error)
+}
+
+// runRestore re-uploads a previously archived tree to a Slack channel,
+// preserving the original filename, title, and an upload comment recording
+// when the file was first seen.
+func runRestore(log *zap.SugaredLogger, args []string) {
+
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	provider := fs.String("provider", "local", "storage backend to restore from: local, s3, or gcs")
+	dir := fs.String("dir", saveDir, "local archive root, for --provider=local")
+	bucket := fs.String("bucket", "", "bucket name, required for --provider=s3 and --provider=gcs")
+	prefix := fs.String("prefix", "", "key prefix the archive was stored under, for --provider=s3 and --provider=gcs")
+	channel := fs.String("channel", "", "channel ID to restore files into")
+	fs.Parse(args)
+
+	if *channel == "" {
+		log.Error("--channel is required")
+		os.Exit(1)
+	}
+
+	slackToken := os.Getenv(tokenEnvVar)
+	if slackToken == "" {
+		log.Errorf("%s env var must be set", tokenEnvVar)
+		os.Exit(1)
+	}
+
+	api := slack.New(slackToken)
+	ctx := context.Background()
+
+	archived, closer, err := listArchive(*provider, *dir, *bucket, *prefix)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+	defer closer.Close()
+
+	for _, file := range archived {
+		if err := restoreFile(ctx, api, *channel, file); err != nil {
+			log.Errorw("error restoring file", "file_id", file.ID, "name", file.Name, "error", err)
+			continue
+		}
+		log.Infow("restored file", "file_id", file.ID, "name", file.Name)
+	}
+}
+
+func restoreFile(ctx context.Context, api *slack.Client, channel string, file archivedFile) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Filename:       file.Name,
+		Title:          file.Name,
+		Channel:        channel,
+		Reader:         r,
+		FileSize:       int(file.Size),
+		InitialComment: fmt.Sprintf("restored file originally archived on %s", file.Timestamp.Format("2006-01-02")),
+	})
+	return err
+}
+
+// nopCloser lets local/S3 listings satisfy the same (files, closer, error)
+// shape as GCS, whose archivedFile.Open closures stay bound to a client
+// that must be closed once the caller is done restoring.
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// listArchive enumerates everything a storage backend has archived, in the
+// YYYY/MM/DD/<id>-<name> layout every backend shares. The returned closer
+// must be closed once every archivedFile.Open has been used.
+func listArchive(provider, dir, bucket, prefix string) ([]archivedFile, io.Closer, error) {
+	switch provider {
+	case "", "local":
+		files, err := listLocalArchive(dir)
+		return files, nopCloser{}, err
+	case "s3":
+		files, err := listS3Archive(bucket, prefix)
+		return files, nopCloser{}, err
+	case "gcs":
+		return listGCSArchive(bucket, prefix)
+	default:
+		return nil, nopCloser{}, fmt.Errorf("unknown storage provider %q", provider)
+	}
+}
+
+func listLocalArchive(dir string) ([]archivedFile, error) {
+	var files []archivedFile
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		id, name, ok := parseArchivedFilename(filepath.Base(path))
+		if !ok {
+			return nil
+		}
+
+		filePath := path
+		files = append(files, archivedFile{
+			ID:        id,
+			Name:      name,
+			Size:      info.Size(),
+			Timestamp: info.ModTime(),
+			Open: func() (io.ReadCloser, error) {
+				return os.Open(filePath)
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// parseArchivedFilename splits the <id>-<name> basename every Storage
+// backend writes back into its parts.
+func parseArchivedFilename(base string) (id, name string, ok bool) {
+	parts := strings.SplitN(base, "-", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/slack-go/slack"
+)
+
+// Storage writes a downloaded Slack file to a durable destination. Each
+// implementation is responsible for laying the file out under the same
+// YYYY/MM/DD/<id>-<name> path convention so archives are interchangeable
+// between backends.
+type Storage interface {
+	// Put streams r to the destination implied by file and returns the
+	// location it was written to (a local path, or an s3://, gs:// URI).
+	Put(file slack.File, r io.Reader) (string, error)
+}
+
+// datedFilePath returns the YYYY/MM/DD/<id>-<name> relative path used by
+// every storage backend.
+func datedFilePath(file slack.File) string {
+	filename := fmt.Sprintf("%s-%s", file.ID, file.Name)
+	year, month, day := file.Timestamp.Time().Date()
+	datePath := fmt.Sprintf("%v/%02d/%v", year, month, day)
+	return filepath.Join(datePath, filename)
+}
+
+// LocalStorage writes files beneath a root directory on local disk. When
+// cache is set, downloads are deduplicated against files already archived
+// under dir, hardlinking instead of writing a second copy.
+type LocalStorage struct {
+	Dir   string
+	cache *diskCache
+}
+
+// NewLocalStorage returns a Storage that writes beneath dir. If
+// cacheMaxBytes is greater than zero, downloads are deduplicated against
+// the cacheMaxBytes most-recently-archived files under dir.
+func NewLocalStorage(dir string, cacheMaxBytes int64) (*LocalStorage, error) {
+	l := &LocalStorage{Dir: dir}
+
+	if cacheMaxBytes > 0 {
+		cache, err := newDiskCache(dir, cacheMaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		l.cache = cache
+	}
+
+	return l, nil
+}
+
+func (l *LocalStorage) Put(file slack.File, r io.Reader) (string, error) {
+	fullFilePath := filepath.Join(l.Dir, datedFilePath(file))
+
+	if l.cache != nil {
+		if _, err := l.cache.Put(r, fullFilePath); err != nil {
+			return "", err
+		}
+		return fullFilePath, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullFilePath), 0755); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(fullFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return "", err
+	}
+
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return fullFilePath, nil
+}
+
+// S3Storage writes files to an S3 (or S3-compatible) bucket.
+type S3Storage struct {
+	Bucket   string
+	Prefix   string
+	uploader *s3Uploader
+}
+
+// NewS3Storage returns a Storage backed by the given bucket. Credentials are
+// taken from the default AWS SDK chain (env vars, shared config, instance
+// role), matching how most teams already run other archival jobs. The
+// underlying client is built once here and reused by every Put, rather than
+// re-resolving credentials on each call.
+func NewS3Storage(bucket, prefix string) (*S3Storage, error) {
+	uploader, err := newS3Uploader()
+	if err != nil {
+		return nil, err
+	}
+	return &S3Storage{Bucket: bucket, Prefix: prefix, uploader: uploader}, nil
+}
+
+func (s *S3Storage) Put(file slack.File, r io.Reader) (string, error) {
+	key := filepath.Join(s.Prefix, datedFilePath(file))
+	if err := s.uploader.Upload(s.Bucket, key, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("s3://%s/%s", s.Bucket, key), nil
+}
+
+// GCSStorage writes files to a Google Cloud Storage bucket.
+type GCSStorage struct {
+	Bucket   string
+	Prefix   string
+	uploader *gcsUploader
+}
+
+// NewGCSStorage returns a Storage backed by the given GCS bucket.
+// Credentials are taken from the standard GOOGLE_APPLICATION_CREDENTIALS
+// environment, matching the rest of the tool's "env var in, client out"
+// convention. The underlying client is built once here and reused by every
+// Put, rather than being dialed afresh on each call.
+func NewGCSStorage(bucket, prefix string) (*GCSStorage, error) {
+	uploader, err := newGCSUploader()
+	if err != nil {
+		return nil, err
+	}
+	return &GCSStorage{Bucket: bucket, Prefix: prefix, uploader: uploader}, nil
+}
+
+func (g *GCSStorage) Put(file slack.File, r io.Reader) (string, error) {
+	key := filepath.Join(g.Prefix, datedFilePath(file))
+	if err := g.uploader.Upload(g.Bucket, key, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("gs://%s/%s", g.Bucket, key), nil
+}
+
+// NewStorage constructs the Storage backend named by provider. Valid values
+// are "local", "s3" and "gcs". cacheMaxBytes only applies to "local"; see
+// NewLocalStorage.
+func NewStorage(provider, dir, bucket, prefix string, cacheMaxBytes int64) (Storage, error) {
+	switch provider {
+	case "", "local":
+		return NewLocalStorage(dir, cacheMaxBytes)
+	case "s3":
+		if bucket == "" {
+			return nil, fmt.Errorf("--bucket is required for --provider=s3")
+		}
+		return NewS3Storage(bucket, prefix)
+	case "gcs":
+		if bucket == "" {
+			return nil, fmt.Errorf("--bucket is required for --provider=gcs")
+		}
+		return NewGCSStorage(bucket, prefix)
+	default:
+		return nil, fmt.Errorf("unknown storage provider %q", provider)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// gcsUploader wraps the GCS client so GCSStorage doesn't have to manage
+// object writer lifecycles directly. The client is dialed once and reused,
+// since re-dialing on every Put is slow and needlessly re-resolves
+// credentials.
+type gcsUploader struct {
+	client *storage.Client
+}
+
+func newGCSUploader() (*gcsUploader, error) {
+	client, err := storage.NewClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &gcsUploader{client: client}, nil
+}
+
+func (u *gcsUploader) Upload(bucket, key string, r io.Reader) error {
+	ctx := context.Background()
+
+	w := u.client.Bucket(bucket).Object(key).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// listGCSArchive walks every object under prefix and reconstructs the
+// archivedFile entries a restore run needs. The returned closer must be
+// closed once the caller is done opening files, since each archivedFile's
+// Open closure reads through the same client.
+func listGCSArchive(bucket, prefix string) ([]archivedFile, io.Closer, error) {
+	ctx := context.Background()
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []archivedFile
+
+	it := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+
+		id, name, ok := parseArchivedFilename(path.Base(attrs.Name))
+		if !ok {
+			continue
+		}
+
+		objectName := attrs.Name
+		files = append(files, archivedFile{
+			ID:        id,
+			Name:      name,
+			Size:      attrs.Size,
+			Timestamp: attrs.Updated,
+			Open: func() (io.ReadCloser, error) {
+				r, err := client.Bucket(bucket).Object(objectName).NewReader(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("fetching gs://%s/%s: %w", bucket, objectName, err)
+				}
+				return r, nil
+			},
+		})
+	}
+
+	return files, client, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Uploader wraps the AWS SDK's managed uploader so S3Storage doesn't have
+// to deal with multipart upload bookkeeping directly. The client and
+// uploader are resolved once and reused, since re-resolving credentials on
+// every Put is slow and can trip STS/IMDS throttling on large workspaces.
+type s3Uploader struct {
+	client   *s3.Client
+	uploader *manager.Uploader
+}
+
+func newS3Uploader() (*s3Uploader, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg)
+
+	return &s3Uploader{
+		client:   client,
+		uploader: manager.NewUploader(client),
+	}, nil
+}
+
+func (u *s3Uploader) Upload(bucket, key string, r io.Reader) error {
+	_, err := u.uploader.Upload(context.Background(), &s3.PutObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+		Body:   r,
+	})
+
+	return err
+}
+
+// listS3Archive walks every object under prefix and reconstructs the
+// archivedFile entries a restore run needs.
+func listS3Archive(bucket, prefix string) ([]archivedFile, error) {
+	ctx := context.Background()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := s3.NewFromConfig(cfg)
+
+	var files []archivedFile
+
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: &bucket,
+		Prefix: &prefix,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			key := *obj.Key
+			id, name, ok := parseArchivedFilename(path.Base(key))
+			if !ok {
+				continue
+			}
+
+			files = append(files, archivedFile{
+				ID:        id,
+				Name:      name,
+				Size:      *obj.Size,
+				Timestamp: *obj.LastModified,
+				Open: func() (io.ReadCloser, error) {
+					out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+					if err != nil {
+						return nil, fmt.Errorf("fetching s3://%s/%s: %w", bucket, key, err)
+					}
+					return out.Body, nil
+				},
+			})
+		}
+	}
+
+	return files, nil
+}